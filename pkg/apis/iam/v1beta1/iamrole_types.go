@@ -17,6 +17,8 @@ limitations under the License.
 package v1beta1
 
 import (
+	"encoding/json"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,7 +29,59 @@ type IAMRoleSpec struct {
 	MaxSessionDuration int64              `json:"maxSessionDuration,omitempty"`
 	TrustRelationship  string             `json:"trustRelationship"`
 	InlinePolicy       []InlinePolicySpec `json:"inlinePolicy,omitempty"`
-	Policies           []string           `json:"policies,omitempty"`
+	Policies           []PolicyRef        `json:"policies,omitempty"`
+	// PolicyAttachmentMode controls whether managed policies attached to the role out-of-band are
+	// detached during sync. Defaults to Exclusive.
+	PolicyAttachmentMode PolicyAttachmentMode `json:"policyAttachmentMode,omitempty"`
+	// InlinePolicyAttachmentMode controls whether inline policies present on the role out-of-band
+	// are removed during sync. Defaults to Exclusive.
+	InlinePolicyAttachmentMode PolicyAttachmentMode `json:"inlinePolicyAttachmentMode,omitempty"`
+	// PermissionsBoundary is a policy ARN or bare name, resolved through getArn, used to scope the
+	// role's effective permissions.
+	PermissionsBoundary string `json:"permissionsBoundary,omitempty"`
+	// Tags are applied to the role via TagRole/UntagRole, for billing and ownership attribution.
+	Tags map[string]string `json:"tags,omitempty"`
+	// InstanceProfile, when Create is set, pairs the role with an IAM instance profile so it can be
+	// consumed directly by EC2/EKS node group workflows.
+	InstanceProfile InstanceProfileSpec `json:"instanceProfile,omitempty"`
+}
+
+// InstanceProfileSpec configures the IAM instance profile paired with a role
+type InstanceProfileSpec struct {
+	Create bool   `json:"create,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// PolicyRef identifies a managed policy to attach to the role, with optional version tracking.
+type PolicyRef struct {
+	// Name is the policy ARN, or a bare policy name resolved through getArn.
+	Name string `json:"name"`
+	// Version pins the managed policy version (e.g. "v3") this role is expected to use. It seeds the
+	// baseline syncPolicyVersions compares against only while Status.AttachedPolicyVersions has no
+	// entry for this policy; once a version is recorded there, the recorded version is the baseline.
+	// Left empty, the DefaultVersionId first observed becomes the baseline.
+	Version string `json:"version,omitempty"`
+	// AutoUpgrade, when true, lets the controller record a newer DefaultVersionId as it appears
+	// instead of only surfacing a PolicyUpgradeAvailable condition for GitOps to act on.
+	AutoUpgrade bool `json:"autoUpgrade,omitempty"`
+}
+
+// UnmarshalJSON allows a PolicyRef to be written as a bare string, the form Policies used before it
+// gained per-entry version tracking, so existing manifests keep working unchanged.
+func (p *PolicyRef) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		p.Name = name
+		return nil
+	}
+	type policyRefAlias PolicyRef
+	var alias policyRefAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	*p = PolicyRef(alias)
+	return nil
 }
 
 // InlinePolicySpec is a key value pair, where the key is the name of the inline policy, and value is the actual policy
@@ -36,10 +90,56 @@ type InlinePolicySpec struct {
 	Value string `json:"value"`
 }
 
+// PolicyAttachmentMode selects whether SyncIAMRole removes policies it did not attach itself.
+type PolicyAttachmentMode string
+
+const (
+	// PolicyAttachmentModeExclusive detaches any attached policy not listed in the spec. This is the default.
+	PolicyAttachmentModeExclusive PolicyAttachmentMode = "Exclusive"
+	// PolicyAttachmentModeAdditive only ensures the listed policies are attached and never detaches
+	// anything else, so other controllers or AWS SSO can attach additional policies out-of-band.
+	PolicyAttachmentModeAdditive PolicyAttachmentMode = "Additive"
+)
+
 // IAMRoleStatus defines the observed state of IAMRole
 type IAMRoleStatus struct {
 	ARN    string `json:"arn,omitempty"`
 	RoleID string `json:"roleId,omitempty"`
+	// NormalizedTrustRelationship is the canonical JSON form of Spec.TrustRelationship, useful for
+	// spotting drift without each reconcile issuing a spurious UpdateAssumeRolePolicy call.
+	NormalizedTrustRelationship string `json:"normalizedTrustRelationship,omitempty"`
+	// PermissionsBoundaryARN is the ARN of the permissions boundary currently attached to the role in AWS.
+	PermissionsBoundaryARN string `json:"permissionsBoundaryArn,omitempty"`
+	// Tags is the role's tag set once sync has converged it to Spec.Tags via TagRole/UntagRole.
+	Tags map[string]string `json:"tags,omitempty"`
+	// InstanceProfileARN is the ARN of the instance profile the role is attached to, when managed.
+	InstanceProfileARN string `json:"instanceProfileArn,omitempty"`
+	// AttachedPolicyVersions records the managed policy DefaultVersionId accepted as the baseline for
+	// each entry in Spec.Policies, keyed by policy name. A newer DefaultVersionId replaces it only
+	// when the entry has AutoUpgrade set.
+	AttachedPolicyVersions map[string]string `json:"attachedPolicyVersions,omitempty"`
+	// Conditions surfaces observations, such as PolicyUpgradeAvailable, that the controller does not
+	// act on itself so GitOps pipelines can see the drift.
+	Conditions []IAMRoleCondition `json:"conditions,omitempty"`
+}
+
+// IAMRoleConditionType is the type of an observation surfaced on IAMRoleStatus.Conditions
+type IAMRoleConditionType string
+
+const (
+	// PolicyUpgradeAvailable indicates a managed policy attached to the role has a newer
+	// DefaultVersionId than the one recorded in Status.AttachedPolicyVersions (or, before anything is
+	// recorded, than the entry's pinned Version), and AutoUpgrade is false, so the controller is
+	// surfacing the drift rather than acting on it.
+	PolicyUpgradeAvailable IAMRoleConditionType = "PolicyUpgradeAvailable"
+)
+
+// IAMRoleCondition is a single observation about the state of an IAMRole
+type IAMRoleCondition struct {
+	Type    IAMRoleConditionType `json:"type"`
+	Status  string               `json:"status"`
+	Reason  string               `json:"reason,omitempty"`
+	Message string               `json:"message,omitempty"`
 }
 
 // +genclient
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 Ian Hoegen.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IAMRolePolicySpec defines the desired state of IAMRolePolicy
+type IAMRolePolicySpec struct {
+	RoleRef        RoleReference `json:"roleRef"`
+	PolicyName     string        `json:"policyName"`
+	PolicyDocument string        `json:"policyDocument"`
+}
+
+// RoleReference identifies the IAMRole an IAMRolePolicy's inline policy should be attached to
+type RoleReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// IAMRolePolicyStatus defines the observed state of IAMRolePolicy
+type IAMRolePolicyStatus struct {
+	RoleName string `json:"roleName,omitempty"`
+	Applied  bool   `json:"applied,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// IAMRolePolicy is the Schema for the iamrolepolicies API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type IAMRolePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IAMRolePolicySpec   `json:"spec,omitempty"`
+	Status IAMRolePolicyStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// IAMRolePolicyList contains a list of IAMRolePolicy
+type IAMRolePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IAMRolePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IAMRolePolicy{}, &IAMRolePolicyList{})
+}
@@ -1,13 +1,14 @@
 package iamrole
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-
 	"github.com/aws/aws-sdk-go/service/iam"
-	"github.com/aws/aws-sdk-go/service/sts"
 	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
 )
 
@@ -15,6 +16,9 @@ import (
 type IAMClient struct {
 	Client *iam.IAM
 	Role   *iamv1beta1.IAMRole
+	// ManagedByIAMRolePolicy lists inline policy names on this role that are owned by a
+	// standalone IAMRolePolicy resource; SyncIAMRole must not delete them during its sweep.
+	ManagedByIAMRolePolicy []string
 }
 
 // NewIAMClient returns a new client for interacting with AWS IAM
@@ -25,21 +29,41 @@ func NewIAMClient(client *iam.IAM, role *iamv1beta1.IAMRole) IAMClient {
 	}
 }
 
+// SetManagedByIAMRolePolicy records inline policy names owned by a standalone IAMRolePolicy, so
+// SyncIAMRole's cleanup sweep leaves them alone. It exists alongside the exported field so IAMClient
+// satisfies roleAWSClient, the seam ReconcileIAMRole's tests substitute a fake behind.
+func (i *IAMClient) SetManagedByIAMRolePolicy(names []string) {
+	i.ManagedByIAMRolePolicy = names
+}
+
 //CreateIAMRole creates an IAM role in AWS, based on a spec
 func (i *IAMClient) CreateIAMRole() error {
 	roleName := i.Role.ObjectMeta.GetName()
-	createRoleOutput, err := i.Client.CreateRole(&iam.CreateRoleInput{
+	createRoleInput := &iam.CreateRoleInput{
 		AssumeRolePolicyDocument: &i.Role.Spec.TrustRelationship,
 		Description:              &i.Role.Spec.Description,
 		Path:                     &i.Role.Spec.Path,
 		RoleName:                 &roleName,
 		MaxSessionDuration:       &i.Role.Spec.MaxSessionDuration,
-	})
+		Tags:                     buildTags(i.Role.Spec.Tags),
+	}
+	if i.Role.Spec.PermissionsBoundary != "" {
+		boundaryArn, err := getArn(i.Role.Spec.PermissionsBoundary)
+		if err != nil {
+			return err
+		}
+		createRoleInput.PermissionsBoundary = &boundaryArn
+	}
+	createRoleOutput, err := i.Client.CreateRole(createRoleInput)
 	if err != nil {
 		return err
 	}
 	i.Role.Status.ARN = *createRoleOutput.Role.Arn
 	i.Role.Status.RoleID = *createRoleOutput.Role.RoleId
+	i.Role.Status.Tags = i.Role.Spec.Tags
+	if createRoleOutput.Role.PermissionsBoundary != nil {
+		i.Role.Status.PermissionsBoundaryARN = *createRoleOutput.Role.PermissionsBoundary.PermissionsBoundaryArn
+	}
 	err = i.createInlinePolicies()
 	if err != nil {
 		return err
@@ -48,12 +72,27 @@ func (i *IAMClient) CreateIAMRole() error {
 	if err != nil {
 		return err
 	}
+	err = i.syncInstanceProfile()
+	if err != nil {
+		return err
+	}
+	err = i.syncPolicyVersions()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
 //DeleteIAMRole deletes an IAM role
 func (i *IAMClient) DeleteIAMRole() error {
 	roleName := i.Role.ObjectMeta.GetName()
+	// The finalizer is added before CreateIAMRole ever runs, so the role may never have been
+	// created (or may have been removed out-of-band) by the time the CR is deleted; in that case
+	// there is nothing left to clean up, and calling on into the listing/delete calls below would
+	// just fail with NoSuchEntityException and strand the finalizer forever.
+	if !i.IAMRoleExists(roleName) {
+		return nil
+	}
 	currentPolicies, err := i.listInlinePolicies(roleName)
 	if err != nil {
 		return err
@@ -80,6 +119,12 @@ func (i *IAMClient) DeleteIAMRole() error {
 			return err
 		}
 	}
+	// AWS rejects DeleteRole while the role is still in an instance profile, including ones
+	// attached out-of-band, so remove it from all of them first.
+	err = i.removeInstanceProfiles(roleName)
+	if err != nil {
+		return err
+	}
 	_, err = i.Client.DeleteRole(&iam.DeleteRoleInput{
 		RoleName: &roleName,
 	})
@@ -115,7 +160,11 @@ func (i *IAMClient) SyncIAMRole() error {
 			return err
 		}
 	}
-	if *awsRole.AssumeRolePolicyDocument != i.Role.Spec.TrustRelationship {
+	trustEqual, err := policyDocumentsEqual(*awsRole.AssumeRolePolicyDocument, i.Role.Spec.TrustRelationship)
+	if err != nil {
+		return err
+	}
+	if !trustEqual {
 		_, err = i.Client.UpdateAssumeRolePolicy(&iam.UpdateAssumeRolePolicyInput{
 			RoleName:       &roleName,
 			PolicyDocument: &i.Role.Spec.TrustRelationship,
@@ -124,7 +173,22 @@ func (i *IAMClient) SyncIAMRole() error {
 			return err
 		}
 	}
-	err = i.createInlinePolicies()
+	if normalized, err := normalizedPolicyDocumentJSON(i.Role.Spec.TrustRelationship); err == nil {
+		i.Role.Status.NormalizedTrustRelationship = normalized
+	}
+	err = i.syncPermissionsBoundary(awsRole)
+	if err != nil {
+		return err
+	}
+	err = i.syncTags(roleName)
+	if err != nil {
+		return err
+	}
+	err = i.syncInstanceProfile()
+	if err != nil {
+		return err
+	}
+	err = i.syncInlinePolicies()
 	if err != nil {
 		return err
 	}
@@ -136,14 +200,16 @@ func (i *IAMClient) SyncIAMRole() error {
 	for _, p := range i.Role.Spec.InlinePolicy {
 		requestedInlinePolicies = append(requestedInlinePolicies, p.Name)
 	}
-	for _, policy := range inlinePolicies {
-		if !in(requestedInlinePolicies, policy) {
-			_, err = i.Client.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
-				PolicyName: &policy,
-				RoleName:   &roleName,
-			})
-			if err != nil {
-				errors = append(errors, err)
+	if i.Role.Spec.InlinePolicyAttachmentMode != iamv1beta1.PolicyAttachmentModeAdditive {
+		for _, policy := range inlinePolicies {
+			if !in(requestedInlinePolicies, policy) && !in(i.ManagedByIAMRolePolicy, policy) {
+				_, err = i.Client.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+					PolicyName: &policy,
+					RoleName:   &roleName,
+				})
+				if err != nil {
+					errors = append(errors, err)
+				}
 			}
 		}
 	}
@@ -155,20 +221,26 @@ func (i *IAMClient) SyncIAMRole() error {
 	if err != nil {
 		return err
 	}
-	for _, policy := range attachedPolicies {
-		if !in(i.Role.Spec.Policies, *policy.PolicyArn) && !in(i.Role.Spec.Policies, *policy.PolicyName) {
-			_, err = i.Client.DetachRolePolicy(&iam.DetachRolePolicyInput{
-				PolicyArn: policy.PolicyArn,
-				RoleName:  &roleName,
-			})
-			if err != nil {
-				errors = append(errors, err)
+	requestedPolicyNames := policyRefNames(i.Role.Spec.Policies)
+	if i.Role.Spec.PolicyAttachmentMode != iamv1beta1.PolicyAttachmentModeAdditive {
+		for _, policy := range attachedPolicies {
+			if !in(requestedPolicyNames, *policy.PolicyArn) && !in(requestedPolicyNames, *policy.PolicyName) {
+				_, err = i.Client.DetachRolePolicy(&iam.DetachRolePolicyInput{
+					PolicyArn: policy.PolicyArn,
+					RoleName:  &roleName,
+				})
+				if err != nil {
+					errors = append(errors, err)
+				}
 			}
 		}
 	}
 	if len(errors) > 0 {
 		return fmt.Errorf("Errors occurred while detaching policies: %v", errors)
 	}
+	if err := i.syncPolicyVersions(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -185,7 +257,7 @@ func (i *IAMClient) attachPolicies() error {
 	roleName := i.Role.ObjectMeta.GetName()
 	var errors []error
 	for _, policy := range i.Role.Spec.Policies {
-		policyArn, err := getArn(policy)
+		policyArn, err := getArn(policy.Name)
 		if err != nil {
 			return err
 		}
@@ -203,6 +275,69 @@ func (i *IAMClient) attachPolicies() error {
 	return nil
 }
 
+// policyRefNames extracts the configured name/ARN from each PolicyRef, for membership checks
+// against AWS's attached-policy listing.
+func policyRefNames(refs []iamv1beta1.PolicyRef) []string {
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+	return names
+}
+
+// syncPolicyVersions inspects each attached managed policy's DefaultVersionId against the desired
+// baseline: whatever was last recorded in status, or PolicyRef.Version when nothing has been
+// recorded yet (i.e. only to seed the very first baseline, not re-read on every pass — otherwise a
+// pinned ref would re-fire the same upgrade event and status write on every single reconcile once
+// the live version moved past the pin, even though nothing changed since). When the live version has
+// moved past that baseline and the PolicyRef opts into AutoUpgrade, the new version is recorded and
+// an event emitted; otherwise a PolicyUpgradeAvailable condition is surfaced so GitOps pipelines can
+// see the drift without the controller changing anything or silently drifting away from a pinned
+// version.
+func (i *IAMClient) syncPolicyVersions() error {
+	if i.Role.Status.AttachedPolicyVersions == nil {
+		i.Role.Status.AttachedPolicyVersions = map[string]string{}
+	}
+	var conditions []iamv1beta1.IAMRoleCondition
+	for _, policyRef := range i.Role.Spec.Policies {
+		policyArn, err := getArn(policyRef.Name)
+		if err != nil {
+			return err
+		}
+		getPolicyOutput, err := i.Client.GetPolicy(&iam.GetPolicyInput{
+			PolicyArn: &policyArn,
+		})
+		if err != nil {
+			return err
+		}
+		latestVersion := *getPolicyOutput.Policy.DefaultVersionId
+		recordedVersion, known := i.Role.Status.AttachedPolicyVersions[policyRef.Name]
+		baseline := recordedVersion
+		if !known {
+			baseline = policyRef.Version
+		}
+		if baseline == "" || baseline == latestVersion {
+			i.Role.Status.AttachedPolicyVersions[policyRef.Name] = latestVersion
+			continue
+		}
+		if policyRef.AutoUpgrade {
+			if eventRecorder != nil {
+				eventRecorder.Event(i.Role, "Normal", "PolicyVersionUpgraded", fmt.Sprintf("Managed policy %s moved from %s to %s", policyRef.Name, baseline, latestVersion))
+			}
+			i.Role.Status.AttachedPolicyVersions[policyRef.Name] = latestVersion
+			continue
+		}
+		conditions = append(conditions, iamv1beta1.IAMRoleCondition{
+			Type:    iamv1beta1.PolicyUpgradeAvailable,
+			Status:  "True",
+			Reason:  "NewerDefaultVersionAvailable",
+			Message: fmt.Sprintf("Managed policy %s has a newer default version (%s) than the expected %s", policyRef.Name, latestVersion, baseline),
+		})
+	}
+	i.Role.Status.Conditions = conditions
+	return nil
+}
+
 // Creates inline polices defined in a spec and attaches it to a role
 func (i *IAMClient) createInlinePolicies() error {
 	var errors []error
@@ -223,17 +358,225 @@ func (i *IAMClient) createInlinePolicies() error {
 	return nil
 }
 
+// syncInlinePolicies reconciles inline policies defined in the spec against what AWS already has,
+// only issuing PutRolePolicy when the normalized documents actually differ, to avoid spurious
+// updates caused by AWS re-serializing policy documents on every read.
+func (i *IAMClient) syncInlinePolicies() error {
+	roleName := i.Role.ObjectMeta.GetName()
+	var errors []error
+	for _, inlinePolicy := range i.Role.Spec.InlinePolicy {
+		getPolicyOutput, err := i.Client.GetRolePolicy(&iam.GetRolePolicyInput{
+			RoleName:   &roleName,
+			PolicyName: &inlinePolicy.Name,
+		})
+		if err == nil {
+			equal, err := policyDocumentsEqual(*getPolicyOutput.PolicyDocument, inlinePolicy.Value)
+			if err != nil {
+				errors = append(errors, err)
+				continue
+			}
+			if equal {
+				continue
+			}
+		}
+		_, err = i.Client.PutRolePolicy(&iam.PutRolePolicyInput{
+			PolicyDocument: &inlinePolicy.Value,
+			RoleName:       &roleName,
+			PolicyName:     &inlinePolicy.Name,
+		})
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("Errors occurred while syncing inline policies: %v", errors)
+	}
+	return nil
+}
+
+// syncPermissionsBoundary reconciles the role's permissions boundary against the spec, resolving a
+// bare policy name through getArn, and records the live boundary ARN on status.
+func (i *IAMClient) syncPermissionsBoundary(awsRole iam.Role) error {
+	roleName := i.Role.ObjectMeta.GetName()
+	var desiredArn string
+	if i.Role.Spec.PermissionsBoundary != "" {
+		var err error
+		desiredArn, err = getArn(i.Role.Spec.PermissionsBoundary)
+		if err != nil {
+			return err
+		}
+	}
+	var currentArn string
+	if awsRole.PermissionsBoundary != nil && awsRole.PermissionsBoundary.PermissionsBoundaryArn != nil {
+		currentArn = *awsRole.PermissionsBoundary.PermissionsBoundaryArn
+	}
+	if desiredArn == currentArn {
+		i.Role.Status.PermissionsBoundaryARN = currentArn
+		return nil
+	}
+	if desiredArn == "" {
+		_, err := i.Client.DeleteRolePermissionsBoundary(&iam.DeleteRolePermissionsBoundaryInput{
+			RoleName: &roleName,
+		})
+		if err != nil {
+			return err
+		}
+		i.Role.Status.PermissionsBoundaryARN = ""
+		return nil
+	}
+	_, err := i.Client.PutRolePermissionsBoundary(&iam.PutRolePermissionsBoundaryInput{
+		RoleName:            &roleName,
+		PermissionsBoundary: &desiredArn,
+	})
+	if err != nil {
+		return err
+	}
+	i.Role.Status.PermissionsBoundaryARN = desiredArn
+	return nil
+}
+
+// syncTags diffs the spec's tags against ListRoleTags and issues TagRole/UntagRole to converge,
+// then records the effective tag set on status.
+func (i *IAMClient) syncTags(roleName string) error {
+	listOutput, err := i.Client.ListRoleTags(&iam.ListRoleTagsInput{
+		RoleName: &roleName,
+	})
+	if err != nil {
+		return err
+	}
+	current := make(map[string]string, len(listOutput.Tags))
+	for _, tag := range listOutput.Tags {
+		current[*tag.Key] = *tag.Value
+	}
+	var untagKeys []*string
+	for key := range current {
+		if _, ok := i.Role.Spec.Tags[key]; !ok {
+			key := key
+			untagKeys = append(untagKeys, &key)
+		}
+	}
+	if len(untagKeys) > 0 {
+		if _, err := i.Client.UntagRole(&iam.UntagRoleInput{RoleName: &roleName, TagKeys: untagKeys}); err != nil {
+			return err
+		}
+	}
+	changed := make(map[string]string)
+	for key, value := range i.Role.Spec.Tags {
+		if existing, ok := current[key]; !ok || existing != value {
+			changed[key] = value
+		}
+	}
+	if len(changed) > 0 {
+		if _, err := i.Client.TagRole(&iam.TagRoleInput{RoleName: &roleName, Tags: buildTags(changed)}); err != nil {
+			return err
+		}
+	}
+	i.Role.Status.Tags = i.Role.Spec.Tags
+	return nil
+}
+
+// buildTags converts a spec tag map into the slice of *iam.Tag the AWS SDK expects
+func buildTags(tags map[string]string) []*iam.Tag {
+	if len(tags) == 0 {
+		return nil
+	}
+	result := make([]*iam.Tag, 0, len(tags))
+	for key, value := range tags {
+		key, value := key, value
+		result = append(result, &iam.Tag{Key: &key, Value: &value})
+	}
+	return result
+}
+
+// instanceProfileName returns the configured instance profile name, defaulting to the role's own name
+func (i *IAMClient) instanceProfileName() string {
+	if i.Role.Spec.InstanceProfile.Name != "" {
+		return i.Role.Spec.InstanceProfile.Name
+	}
+	return i.Role.ObjectMeta.GetName()
+}
+
+// syncInstanceProfile ensures the configured instance profile exists and has this role attached, so
+// IAMRole resources are directly consumable by EC2/EKS node group workflows without a second tool.
+func (i *IAMClient) syncInstanceProfile() error {
+	if !i.Role.Spec.InstanceProfile.Create {
+		return nil
+	}
+	roleName := i.Role.ObjectMeta.GetName()
+	profileName := i.instanceProfileName()
+	getOutput, err := i.Client.GetInstanceProfile(&iam.GetInstanceProfileInput{
+		InstanceProfileName: &profileName,
+	})
+	if err != nil {
+		createInput := &iam.CreateInstanceProfileInput{
+			InstanceProfileName: &profileName,
+		}
+		if i.Role.Spec.InstanceProfile.Path != "" {
+			createInput.Path = &i.Role.Spec.InstanceProfile.Path
+		}
+		createOutput, err := i.Client.CreateInstanceProfile(createInput)
+		if err != nil {
+			return err
+		}
+		i.Role.Status.InstanceProfileARN = *createOutput.InstanceProfile.Arn
+		_, err = i.Client.AddRoleToInstanceProfile(&iam.AddRoleToInstanceProfileInput{
+			InstanceProfileName: &profileName,
+			RoleName:            &roleName,
+		})
+		return err
+	}
+	i.Role.Status.InstanceProfileARN = *getOutput.InstanceProfile.Arn
+	for _, role := range getOutput.InstanceProfile.Roles {
+		if role.RoleName != nil && *role.RoleName == roleName {
+			return nil
+		}
+	}
+	_, err = i.Client.AddRoleToInstanceProfile(&iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: &profileName,
+		RoleName:            &roleName,
+	})
+	return err
+}
+
+// removeInstanceProfiles strips the role from every instance profile it belongs to, including ones
+// attached out-of-band, and deletes the instance profile this spec manages. AWS rejects DeleteRole
+// while the role is still a member of any instance profile.
+func (i *IAMClient) removeInstanceProfiles(roleName string) error {
+	listOutput, err := i.Client.ListInstanceProfilesForRole(&iam.ListInstanceProfilesForRoleInput{
+		RoleName: &roleName,
+	})
+	if err != nil {
+		return err
+	}
+	for _, profile := range listOutput.InstanceProfiles {
+		_, err = i.Client.RemoveRoleFromInstanceProfile(&iam.RemoveRoleFromInstanceProfileInput{
+			InstanceProfileName: profile.InstanceProfileName,
+			RoleName:            &roleName,
+		})
+		if err != nil {
+			return err
+		}
+		if i.Role.Spec.InstanceProfile.Create && *profile.InstanceProfileName == i.instanceProfileName() {
+			_, err = i.Client.DeleteInstanceProfile(&iam.DeleteInstanceProfileInput{
+				InstanceProfileName: profile.InstanceProfileName,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Returns the ARN of a policy; allows for simply naming policies
 func getArn(policyName string) (string, error) {
 	if isArn(policyName) {
 		return policyName, nil
 	}
-	stsClient := sts.New(session.New())
-	callerIdentity, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
-	if err != nil {
-		return "", err
+	if accountID == "" {
+		return "", fmt.Errorf("account ID has not been resolved; the iamrole controller must be added via Add before getArn is called")
 	}
-	return fmt.Sprintf("arn:aws:iam::%s:policy/%s", *callerIdentity.Account, policyName), nil
+	return fmt.Sprintf("arn:aws:iam::%s:policy/%s", accountID, policyName), nil
 }
 
 // Returns if a policy string is an ARN
@@ -326,3 +669,95 @@ func (i *IAMClient) listAttachedPolicies(roleName string) ([]iam.AttachedPolicy,
 	}
 	return policyNameValues, nil
 }
+
+// sortedPolicyKeys are the policy document keys whose values AWS may reorder or collapse between a
+// single string and a single-element array; they're normalized the same way regardless of nesting,
+// which covers both top-level Action/Resource statements and Principal.AWS/Principal.Service.
+var sortedPolicyKeys = map[string]bool{
+	"Action":      true,
+	"NotAction":   true,
+	"Resource":    true,
+	"NotResource": true,
+	"AWS":         true,
+	"Service":     true,
+}
+
+// policyDocumentsEqual reports whether two policy documents are semantically equivalent, ignoring
+// object key order and AWS's habit of collapsing single-element arrays into bare strings (and vice
+// versa) when it re-serializes a policy document. a is expected to be a document just read back from
+// AWS (GetRole/GetRolePolicy), which AWS URL-encodes; b is the raw spec string from the CR, which
+// never is.
+func policyDocumentsEqual(a, b string) (bool, error) {
+	normA, err := normalizedPolicyDocument(a, true)
+	if err != nil {
+		return false, err
+	}
+	normB, err := normalizedPolicyDocument(b, false)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(normA, normB), nil
+}
+
+// normalizedPolicyDocumentJSON returns the canonical JSON form of a spec policy document, suitable
+// for surfacing on status so drift is observable even when SyncIAMRole decides no update is needed.
+func normalizedPolicyDocumentJSON(doc string) (string, error) {
+	normalized, err := normalizedPolicyDocument(doc, false)
+	if err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// normalizedPolicyDocument parses a policy document into its normalized form. urlDecode must only be
+// set for documents AWS itself returned (GetRole/GetRolePolicy URL-encode them); a raw spec string
+// straight from the CR is plain JSON, and QueryUnescape-ing it would silently turn a literal "+" (legal
+// in IAM paths and S3 resource patterns) into a space.
+func normalizedPolicyDocument(doc string, urlDecode bool) (interface{}, error) {
+	if urlDecode {
+		if decoded, err := url.QueryUnescape(doc); err == nil {
+			doc = decoded
+		}
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(doc), &parsed); err != nil {
+		return nil, err
+	}
+	return normalizePolicyValue("", parsed), nil
+}
+
+// normalizePolicyValue recursively normalizes a decoded policy document: object key order is
+// naturally irrelevant once unmarshaled into a map, and values under sortedPolicyKeys are coerced
+// into a sorted slice regardless of whether AWS represented them as a bare string or an array.
+func normalizePolicyValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for k, sub := range v {
+			normalized[k] = normalizePolicyValue(k, sub)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for idx, sub := range v {
+			normalized[idx] = normalizePolicyValue(key, sub)
+		}
+		if sortedPolicyKeys[key] {
+			sort.Slice(normalized, func(a, b int) bool {
+				return fmt.Sprintf("%v", normalized[a]) < fmt.Sprintf("%v", normalized[b])
+			})
+		}
+		return normalized
+	case string:
+		if sortedPolicyKeys[key] {
+			return []interface{}{v}
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,76 @@
+package iamrole
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestGetArnPassthrough(t *testing.T) {
+	arn := "arn:aws:iam::123456789012:policy/Example"
+	got, err := getArn(arn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != arn {
+		t.Fatalf("expected getArn to pass ARNs through unchanged, got %q", got)
+	}
+}
+
+func TestGetArnResolvesBareNameFromCachedAccountID(t *testing.T) {
+	accountID = "123456789012"
+	defer func() { accountID = "" }()
+
+	got, err := getArn("Example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "arn:aws:iam::123456789012:policy/Example"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestGetArnErrorsWithoutCachedAccountID(t *testing.T) {
+	accountID = ""
+	if _, err := getArn("Example"); err == nil {
+		t.Fatal("expected an error when no account ID has been cached yet")
+	}
+}
+
+func TestGetArnDoesNotCallSTS(t *testing.T) {
+	calls := 0
+	original := resolveAccountID
+	resolveAccountID = func(sess *session.Session) (string, error) {
+		calls++
+		return "999999999999", nil
+	}
+	defer func() { resolveAccountID = original }()
+
+	accountID = "123456789012"
+	defer func() { accountID = "" }()
+
+	for i := 0; i < 5; i++ {
+		if _, err := getArn("Example"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("expected getArn to never trigger the STS lookup, got %d calls", calls)
+	}
+}
+
+func TestFinalizerHelpers(t *testing.T) {
+	var finalizers []string
+	if containsString(finalizers, roleFinalizer) {
+		t.Fatal("expected finalizer to be absent initially")
+	}
+	finalizers = append(finalizers, roleFinalizer)
+	if !containsString(finalizers, roleFinalizer) {
+		t.Fatal("expected finalizer to be present after adding it")
+	}
+	finalizers = removeString(finalizers, roleFinalizer)
+	if containsString(finalizers, roleFinalizer) {
+		t.Fatal("expected finalizer to be removed")
+	}
+}
@@ -0,0 +1,25 @@
+package iamrole
+
+import (
+	"testing"
+
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestDeleteIAMRoleNoOpWhenRoleNeverExisted exercises the real (non-faked) DeleteIAMRole against a
+// not-found role: the finalizer is added before CreateIAMRole ever runs, so the role may never have
+// been created by the time the CR is deleted, and DeleteIAMRole must return cleanly instead of
+// chasing NoSuchEntityException through the listing/detach calls below.
+func TestDeleteIAMRoleNoOpWhenRoleNeverExisted(t *testing.T) {
+	stub := newIAMAPIStub(t).on("GetRole", 404, notFoundXML("Role"))
+	role := &iamv1beta1.IAMRole{ObjectMeta: metav1.ObjectMeta{Name: "never-created"}}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.DeleteIAMRole(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stub.calls) != 1 || stub.calls[0] != "GetRole" {
+		t.Fatalf("expected only the GetRole existence check, got %v", stub.calls)
+	}
+}
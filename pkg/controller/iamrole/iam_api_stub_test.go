@@ -0,0 +1,70 @@
+package iamrole
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// iamAPIStub scripts canned XML responses for individual IAM API actions behind a real *iam.IAM
+// client, so tests can exercise IAMClient's methods as written instead of against a fake interface.
+// It also records every action invoked, so a test can assert on what was (and wasn't) called.
+type iamAPIStub struct {
+	t         *testing.T
+	responses map[string]iamStubResponse
+	calls     []string
+}
+
+type iamStubResponse struct {
+	status int
+	body   string
+}
+
+func newIAMAPIStub(t *testing.T) *iamAPIStub {
+	return &iamAPIStub{t: t, responses: map[string]iamStubResponse{}}
+}
+
+// on scripts the response for a single IAM API action, keyed by its "Action" form value.
+func (s *iamAPIStub) on(action string, status int, body string) *iamAPIStub {
+	s.responses[action] = iamStubResponse{status: status, body: body}
+	return s
+}
+
+// client builds a real *iam.IAM pointed at an httptest server backed by this stub's scripted
+// responses. The server is closed automatically when the test ends.
+func (s *iamAPIStub) client() *iam.IAM {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			s.t.Fatalf("failed to parse request form: %v", err)
+		}
+		action := r.FormValue("Action")
+		s.calls = append(s.calls, action)
+		resp, ok := s.responses[action]
+		if !ok {
+			s.t.Fatalf("unexpected IAM API call: %s", action)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(resp.status)
+		io.WriteString(w, resp.body)
+	}))
+	s.t.Cleanup(server.Close)
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		DisableSSL:  aws.Bool(true),
+		MaxRetries:  aws.Int(0),
+	}))
+	return iam.New(sess)
+}
+
+// notFoundXML is the canned NoSuchEntity error body IAM returns for a missing role/policy/profile.
+func notFoundXML(kind string) string {
+	return `<ErrorResponse><Error><Type>Sender</Type><Code>NoSuchEntity</Code><Message>` + kind + ` not found</Message></Error><RequestId>test-request-id</RequestId></ErrorResponse>`
+}
@@ -22,8 +22,8 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
 	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -34,12 +34,40 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// roleFinalizer lets us clean up the role (and its instance profiles, policies, etc.) in AWS before
+// the IAMRole is removed from etcd.
+const roleFinalizer = "iam.amazonaws.com/role-finalizer"
+
 var eventRecorder record.EventRecorder
 
+// iamSvc and accountID are built once in Add rather than per-reconcile: constructing a session and
+// calling GetCallerIdentity on every reconcile is slow and burns STS quota for no benefit, since the
+// account a controller runs under never changes over its lifetime.
+var iamSvc *iam.IAM
+var accountID string
+
+// resolveAccountID looks up the account the controller is running under. It's a package-level var,
+// rather than an inline call in Add, so tests can substitute a stub and assert it is never invoked
+// outside of Add itself.
+var resolveAccountID = func(sess *session.Session) (string, error) {
+	callerIdentity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return *callerIdentity.Account, nil
+}
+
 // Add creates a new IAMRole Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
 	log.Println("IAMRole controller added")
+	sess := session.New()
+	iamSvc = iam.New(sess)
+	var err error
+	accountID, err = resolveAccountID(sess)
+	if err != nil {
+		return err
+	}
 	return add(mgr, newReconciler(mgr))
 }
 
@@ -65,6 +93,23 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	return nil
 }
 
+// roleAWSClient is the subset of IAMClient behavior Reconcile depends on. It exists so tests can
+// substitute a fake and exercise the finalizer state machine without making real AWS calls.
+type roleAWSClient interface {
+	IAMRoleExists(roleName string) bool
+	CreateIAMRole() error
+	SyncIAMRole() error
+	DeleteIAMRole() error
+	SetManagedByIAMRolePolicy(names []string)
+}
+
+// newRoleAWSClient is a package-level var, rather than a direct NewIAMClient call, so tests can swap
+// in a fake roleAWSClient.
+var newRoleAWSClient = func(client *iam.IAM, role *iamv1beta1.IAMRole) roleAWSClient {
+	ic := NewIAMClient(client, role)
+	return &ic
+}
+
 var _ reconcile.Reconciler = &ReconcileIAMRole{}
 
 // ReconcileIAMRole reconciles a IAMRole object
@@ -81,30 +126,53 @@ type ReconcileIAMRole struct {
 func (r *ReconcileIAMRole) Reconcile(request reconcile.Request) (reconcile.Result, error) {
 	// Fetch the IAMRole instance
 	iamRole := &iamv1beta1.IAMRole{}
-	iamClient := iam.New(session.New())
 	err := r.Get(context.TODO(), request.NamespacedName, iamRole)
 	if err != nil {
-		// IAM role deleted
-		if errors.IsNotFound(err) {
-			iamRole.ObjectMeta.SetName(request.Name)
-			err = DeleteIAMRole(iamClient, iamRole)
+		// IAMRole already gone from the cluster; the finalizer below already handled AWS cleanup
+		// before it was removed, so there is nothing left to do.
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	awsClient := newRoleAWSClient(iamSvc, iamRole)
+
+	// IAMRole is being deleted
+	if !iamRole.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !containsString(iamRole.ObjectMeta.Finalizers, roleFinalizer) {
+			return reconcile.Result{}, nil
+		}
+		if err := awsClient.DeleteIAMRole(); err != nil {
+			eventRecorder.Event(iamRole, "Warning", "ErrorDeletingIAMRole", err.Error())
+			return reconcile.Result{}, err
+		}
+		iamRole.ObjectMeta.Finalizers = removeString(iamRole.ObjectMeta.Finalizers, roleFinalizer)
+		return reconcile.Result{}, r.Update(context.TODO(), iamRole)
+	}
+
+	// Make sure the finalizer is present before we touch AWS state
+	if !containsString(iamRole.ObjectMeta.Finalizers, roleFinalizer) {
+		iamRole.ObjectMeta.Finalizers = append(iamRole.ObjectMeta.Finalizers, roleFinalizer)
+		if err := r.Update(context.TODO(), iamRole); err != nil {
 			return reconcile.Result{}, err
 		}
-		// Error reading the object - requeue the request.
+	}
+
+	managedByIAMRolePolicy, err := r.listManagedInlinePolicyNames(iamRole)
+	if err != nil {
 		return reconcile.Result{}, err
 	}
+	awsClient.SetManagedByIAMRolePolicy(managedByIAMRolePolicy)
 	// IAM Role exists in AWS; updating
-	if iamRoleExists(iamClient, iamRole.ObjectMeta.GetName()) {
-		err = SyncIAMRole(iamClient, iamRole)
+	if awsClient.IAMRoleExists(iamRole.ObjectMeta.GetName()) {
+		err = awsClient.SyncIAMRole()
 		if err != nil {
 			eventRecorder.Event(iamRole, "Warning", "ErrorSyncingIAMRole", err.Error())
 			return reconcile.Result{}, err
 		}
 		eventRecorder.Event(iamRole, "Normal", "IAMRoleUpdated", "Successfully updated IAM role")
-		return reconcile.Result{}, nil
+		return reconcile.Result{}, r.Update(context.TODO(), iamRole)
 	}
 	// IAM Role doesn't exist in AWS; creating
-	err = CreateIAMRole(iamClient, iamRole)
+	err = awsClient.CreateIAMRole()
 	if err != nil {
 		eventRecorder.Event(iamRole, "Warning", "ErrorCreatingIAMRole", err.Error())
 		return reconcile.Result{}, err
@@ -114,3 +182,48 @@ func (r *ReconcileIAMRole) Reconcile(request reconcile.Request) (reconcile.Resul
 	return reconcile.Result{}, err
 
 }
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(slice []string, s string) []string {
+	var result []string
+	for _, item := range slice {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// listManagedInlinePolicyNames returns the inline policy names on iamRole that are owned by a
+// standalone IAMRolePolicy resource, so SyncIAMRole's cleanup sweep can leave them alone. An
+// IAMRolePolicy's RoleRef can target a role in a different namespace than its own (teams with
+// different RBAC scopes own roles and policies separately), so this lists cluster-wide and filters
+// on RoleRef rather than scoping the List call to iamRole's namespace.
+func (r *ReconcileIAMRole) listManagedInlinePolicyNames(iamRole *iamv1beta1.IAMRole) ([]string, error) {
+	rolePolicies := &iamv1beta1.IAMRolePolicyList{}
+	if err := r.List(context.TODO(), &client.ListOptions{}, rolePolicies); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, rolePolicy := range rolePolicies.Items {
+		roleRef := rolePolicy.Spec.RoleRef
+		// An empty RoleRef.Namespace means "same namespace as the IAMRolePolicy itself", not "same
+		// namespace as iamRole" — resolve it relative to where the IAMRolePolicy lives.
+		roleRefNamespace := roleRef.Namespace
+		if roleRefNamespace == "" {
+			roleRefNamespace = rolePolicy.ObjectMeta.GetNamespace()
+		}
+		if roleRef.Name == iamRole.ObjectMeta.GetName() && roleRefNamespace == iamRole.ObjectMeta.GetNamespace() {
+			names = append(names, rolePolicy.Spec.PolicyName)
+		}
+	}
+	return names, nil
+}
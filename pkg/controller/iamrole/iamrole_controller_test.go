@@ -0,0 +1,185 @@
+package iamrole
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeRoleAWSClient is a roleAWSClient test double: it records what Reconcile asked of it instead of
+// making real AWS calls.
+type fakeRoleAWSClient struct {
+	exists                              bool
+	createCalls, syncCalls, deleteCalls int
+	createErr, syncErr, deleteErr       error
+	managedNames                        []string
+}
+
+func (f *fakeRoleAWSClient) IAMRoleExists(roleName string) bool { return f.exists }
+func (f *fakeRoleAWSClient) CreateIAMRole() error               { f.createCalls++; return f.createErr }
+func (f *fakeRoleAWSClient) SyncIAMRole() error                 { f.syncCalls++; return f.syncErr }
+func (f *fakeRoleAWSClient) DeleteIAMRole() error               { f.deleteCalls++; return f.deleteErr }
+func (f *fakeRoleAWSClient) SetManagedByIAMRolePolicy(names []string) {
+	f.managedNames = names
+}
+
+// stubRoleAWSClient overrides newRoleAWSClient for the duration of a test.
+func stubRoleAWSClient(fake roleAWSClient) func() {
+	original := newRoleAWSClient
+	newRoleAWSClient = func(*iam.IAM, *iamv1beta1.IAMRole) roleAWSClient { return fake }
+	return func() { newRoleAWSClient = original }
+}
+
+// setFakeEventRecorder overrides the package-level eventRecorder for the duration of a test.
+func setFakeEventRecorder() func() {
+	original := eventRecorder
+	eventRecorder = record.NewFakeRecorder(10)
+	return func() { eventRecorder = original }
+}
+
+// fakeK8sClient is a minimal client.Client test double backing a single IAMRole and a set of
+// IAMRolePolicy objects, enough to drive ReconcileIAMRole.Reconcile without a real API server.
+type fakeK8sClient struct {
+	role         *iamv1beta1.IAMRole
+	rolePolicies []iamv1beta1.IAMRolePolicy
+	updates      int
+}
+
+func (f *fakeK8sClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	role, ok := obj.(*iamv1beta1.IAMRole)
+	if !ok {
+		return fmt.Errorf("fakeK8sClient.Get: unsupported type %T", obj)
+	}
+	if f.role == nil || key.Name != f.role.Name || key.Namespace != f.role.Namespace {
+		return errors.NewNotFound(schema.GroupResource{Group: "iam.amazonaws.com", Resource: "iamroles"}, key.Name)
+	}
+	*role = *f.role
+	return nil
+}
+
+func (f *fakeK8sClient) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	rolePolicyList, ok := list.(*iamv1beta1.IAMRolePolicyList)
+	if !ok {
+		return fmt.Errorf("fakeK8sClient.List: unsupported type %T", list)
+	}
+	rolePolicyList.Items = f.rolePolicies
+	return nil
+}
+
+func (f *fakeK8sClient) Create(ctx context.Context, obj runtime.Object) error {
+	return fmt.Errorf("fakeK8sClient.Create: not implemented")
+}
+
+func (f *fakeK8sClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	return fmt.Errorf("fakeK8sClient.Delete: not implemented")
+}
+
+func (f *fakeK8sClient) Update(ctx context.Context, obj runtime.Object) error {
+	role, ok := obj.(*iamv1beta1.IAMRole)
+	if !ok {
+		return fmt.Errorf("fakeK8sClient.Update: unsupported type %T", obj)
+	}
+	f.updates++
+	updated := *role
+	f.role = &updated
+	return nil
+}
+
+func (f *fakeK8sClient) Status() client.StatusWriter {
+	return f
+}
+
+func TestReconcileIAMRole_AddsFinalizerOnFirstReconcile(t *testing.T) {
+	defer setFakeEventRecorder()()
+
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role", Namespace: "default"},
+	}
+	fakeClient := &fakeK8sClient{role: role}
+	fakeAWS := &fakeRoleAWSClient{exists: true}
+	defer stubRoleAWSClient(fakeAWS)()
+
+	r := &ReconcileIAMRole{Client: fakeClient}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "my-role", Namespace: "default"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !containsString(fakeClient.role.Finalizers, roleFinalizer) {
+		t.Fatal("expected finalizer to be added on first reconcile")
+	}
+	if fakeAWS.syncCalls != 1 {
+		t.Fatalf("expected SyncIAMRole to be called once, got %d", fakeAWS.syncCalls)
+	}
+	if fakeAWS.deleteCalls != 0 {
+		t.Fatalf("expected DeleteIAMRole not to be called, got %d", fakeAWS.deleteCalls)
+	}
+}
+
+func TestReconcileIAMRole_SkipsDeleteWhenFinalizerAlreadyRemoved(t *testing.T) {
+	defer setFakeEventRecorder()()
+
+	deletionTime := metav1.NewTime(time.Now())
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "my-role",
+			Namespace:         "default",
+			DeletionTimestamp: &deletionTime,
+		},
+	}
+	fakeClient := &fakeK8sClient{role: role}
+	fakeAWS := &fakeRoleAWSClient{exists: true}
+	defer stubRoleAWSClient(fakeAWS)()
+
+	r := &ReconcileIAMRole{Client: fakeClient}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "my-role", Namespace: "default"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fakeAWS.deleteCalls != 0 {
+		t.Fatalf("expected no DeleteIAMRole call once the finalizer is already gone, got %d", fakeAWS.deleteCalls)
+	}
+}
+
+func TestReconcileIAMRole_DeletesAndRemovesFinalizerOnDeletionTimestamp(t *testing.T) {
+	defer setFakeEventRecorder()()
+
+	deletionTime := metav1.NewTime(time.Now())
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "my-role",
+			Namespace:         "default",
+			DeletionTimestamp: &deletionTime,
+			Finalizers:        []string{roleFinalizer},
+		},
+	}
+	fakeClient := &fakeK8sClient{role: role}
+	fakeAWS := &fakeRoleAWSClient{}
+	defer stubRoleAWSClient(fakeAWS)()
+
+	r := &ReconcileIAMRole{Client: fakeClient}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "my-role", Namespace: "default"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fakeAWS.deleteCalls != 1 {
+		t.Fatalf("expected DeleteIAMRole to be called once, got %d", fakeAWS.deleteCalls)
+	}
+	if containsString(fakeClient.role.Finalizers, roleFinalizer) {
+		t.Fatal("expected finalizer to be removed after delete")
+	}
+}
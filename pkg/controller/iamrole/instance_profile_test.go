@@ -0,0 +1,125 @@
+package iamrole
+
+import (
+	"testing"
+
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncInstanceProfileNoopWhenNotRequested(t *testing.T) {
+	stub := newIAMAPIStub(t)
+	role := &iamv1beta1.IAMRole{ObjectMeta: metav1.ObjectMeta{Name: "my-role"}}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncInstanceProfile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stub.calls) != 0 {
+		t.Fatalf("expected no AWS calls when InstanceProfile.Create is unset, got %v", stub.calls)
+	}
+}
+
+func TestSyncInstanceProfileCreatesWhenMissing(t *testing.T) {
+	stub := newIAMAPIStub(t).
+		on("GetInstanceProfile", 404, notFoundXML("InstanceProfile")).
+		on("CreateInstanceProfile", 200, `<CreateInstanceProfileResponse><CreateInstanceProfileResult><InstanceProfile><InstanceProfileId>AID1</InstanceProfileId><InstanceProfileName>my-role</InstanceProfileName><Path>/</Path><Arn>arn:aws:iam::123456789012:instance-profile/my-role</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate><Roles/></InstanceProfile></CreateInstanceProfileResult></CreateInstanceProfileResponse>`).
+		on("AddRoleToInstanceProfile", 200, `<AddRoleToInstanceProfileResponse></AddRoleToInstanceProfileResponse>`)
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{InstanceProfile: iamv1beta1.InstanceProfileSpec{Create: true}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncInstanceProfile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if role.Status.InstanceProfileARN != "arn:aws:iam::123456789012:instance-profile/my-role" {
+		t.Fatalf("unexpected InstanceProfileARN: %q", role.Status.InstanceProfileARN)
+	}
+}
+
+func TestSyncInstanceProfileAddsRoleWhenProfileExistsWithoutIt(t *testing.T) {
+	stub := newIAMAPIStub(t).
+		on("GetInstanceProfile", 200, `<GetInstanceProfileResponse><GetInstanceProfileResult><InstanceProfile><InstanceProfileId>AID1</InstanceProfileId><InstanceProfileName>my-role</InstanceProfileName><Path>/</Path><Arn>arn:aws:iam::123456789012:instance-profile/my-role</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate><Roles/></InstanceProfile></GetInstanceProfileResult></GetInstanceProfileResponse>`).
+		on("AddRoleToInstanceProfile", 200, `<AddRoleToInstanceProfileResponse></AddRoleToInstanceProfileResponse>`)
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{InstanceProfile: iamv1beta1.InstanceProfileSpec{Create: true}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncInstanceProfile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found := false
+	for _, c := range stub.calls {
+		if c == "AddRoleToInstanceProfile" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected AddRoleToInstanceProfile to be called, got %v", stub.calls)
+	}
+}
+
+func TestSyncInstanceProfileSkipsAddWhenRoleAlreadyMember(t *testing.T) {
+	stub := newIAMAPIStub(t).
+		on("GetInstanceProfile", 200, `<GetInstanceProfileResponse><GetInstanceProfileResult><InstanceProfile><InstanceProfileId>AID1</InstanceProfileId><InstanceProfileName>my-role</InstanceProfileName><Path>/</Path><Arn>arn:aws:iam::123456789012:instance-profile/my-role</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate><Roles><member><RoleName>my-role</RoleName><RoleId>R1</RoleId><Path>/</Path><Arn>arn:aws:iam::123456789012:role/my-role</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate><AssumeRolePolicyDocument>e30=</AssumeRolePolicyDocument></member></Roles></InstanceProfile></GetInstanceProfileResult></GetInstanceProfileResponse>`)
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{InstanceProfile: iamv1beta1.InstanceProfileSpec{Create: true}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncInstanceProfile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range stub.calls {
+		if c == "AddRoleToInstanceProfile" {
+			t.Fatalf("expected no AddRoleToInstanceProfile call once the role is already a member, got %v", stub.calls)
+		}
+	}
+}
+
+func TestRemoveInstanceProfilesDeletesTheManagedOne(t *testing.T) {
+	stub := newIAMAPIStub(t).
+		on("ListInstanceProfilesForRole", 200, `<ListInstanceProfilesForRoleResponse><ListInstanceProfilesForRoleResult><InstanceProfiles><member><InstanceProfileId>AID1</InstanceProfileId><InstanceProfileName>my-role</InstanceProfileName><Path>/</Path><Arn>arn:aws:iam::123456789012:instance-profile/my-role</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate><Roles/></member></InstanceProfiles><IsTruncated>false</IsTruncated></ListInstanceProfilesForRoleResult></ListInstanceProfilesForRoleResponse>`).
+		on("RemoveRoleFromInstanceProfile", 200, `<RemoveRoleFromInstanceProfileResponse></RemoveRoleFromInstanceProfileResponse>`).
+		on("DeleteInstanceProfile", 200, `<DeleteInstanceProfileResponse></DeleteInstanceProfileResponse>`)
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{InstanceProfile: iamv1beta1.InstanceProfileSpec{Create: true}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.removeInstanceProfiles("my-role"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found := false
+	for _, c := range stub.calls {
+		if c == "DeleteInstanceProfile" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected the managed instance profile to be deleted, got %v", stub.calls)
+	}
+}
+
+func TestRemoveInstanceProfilesLeavesOutOfBandOnesAlone(t *testing.T) {
+	stub := newIAMAPIStub(t).
+		on("ListInstanceProfilesForRole", 200, `<ListInstanceProfilesForRoleResponse><ListInstanceProfilesForRoleResult><InstanceProfiles><member><InstanceProfileId>AID1</InstanceProfileId><InstanceProfileName>other-profile</InstanceProfileName><Path>/</Path><Arn>arn:aws:iam::123456789012:instance-profile/other-profile</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate><Roles/></member></InstanceProfiles><IsTruncated>false</IsTruncated></ListInstanceProfilesForRoleResult></ListInstanceProfilesForRoleResponse>`).
+		on("RemoveRoleFromInstanceProfile", 200, `<RemoveRoleFromInstanceProfileResponse></RemoveRoleFromInstanceProfileResponse>`)
+	role := &iamv1beta1.IAMRole{ObjectMeta: metav1.ObjectMeta{Name: "my-role"}}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.removeInstanceProfiles("my-role"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range stub.calls {
+		if c == "DeleteInstanceProfile" {
+			t.Fatalf("expected an instance profile this spec doesn't manage not to be deleted, got %v", stub.calls)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package iamrole
+
+import (
+	"strconv"
+	"testing"
+
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getRoleXML builds a minimal GetRole response that already matches the role spec used by these
+// tests, so SyncIAMRole's description/duration/trust convergence checks are all no-ops and only the
+// attachment-mode sweep logic under test issues any AWS calls.
+func getRoleXML(description, trust string, maxSession int64) string {
+	return `<GetRoleResponse><GetRoleResult><Role><RoleName>my-role</RoleName><RoleId>R1</RoleId><Path>/</Path><Arn>arn:aws:iam::123456789012:role/my-role</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate><AssumeRolePolicyDocument>` + trust + `</AssumeRolePolicyDocument><Description>` + description + `</Description><MaxSessionDuration>` + strconv.FormatInt(maxSession, 10) + `</MaxSessionDuration></Role></GetRoleResult></GetRoleResponse>`
+}
+
+// newAttachmentModeFixture wires up a role whose only out-of-band drift is a stray attached managed
+// policy ("Stray") and a stray inline policy ("StrayInline"); mode is applied to both
+// PolicyAttachmentMode and InlinePolicyAttachmentMode so a single fixture covers both sweeps.
+func newAttachmentModeFixture(t *testing.T, mode iamv1beta1.PolicyAttachmentMode) (*IAMClient, *iamAPIStub) {
+	stub := newIAMAPIStub(t).
+		on("GetRole", 200, getRoleXML("d", "{}", 3600)).
+		on("ListRoleTags", 200, `<ListRoleTagsResponse><ListRoleTagsResult><Tags/><IsTruncated>false</IsTruncated></ListRoleTagsResult></ListRoleTagsResponse>`).
+		on("ListRolePolicies", 200, `<ListRolePoliciesResponse><ListRolePoliciesResult><PolicyNames><member>StrayInline</member></PolicyNames><IsTruncated>false</IsTruncated></ListRolePoliciesResult></ListRolePoliciesResponse>`).
+		on("DeleteRolePolicy", 200, `<DeleteRolePolicyResponse></DeleteRolePolicyResponse>`).
+		on("AttachRolePolicy", 200, `<AttachRolePolicyResponse></AttachRolePolicyResponse>`).
+		on("ListAttachedRolePolicies", 200, `<ListAttachedRolePoliciesResponse><ListAttachedRolePoliciesResult><AttachedPolicies><member><PolicyName>Keep</PolicyName><PolicyArn>arn:aws:iam::123456789012:policy/Keep</PolicyArn></member><member><PolicyName>Stray</PolicyName><PolicyArn>arn:aws:iam::123456789012:policy/Stray</PolicyArn></member></AttachedPolicies><IsTruncated>false</IsTruncated></ListAttachedRolePoliciesResult></ListAttachedRolePoliciesResponse>`).
+		on("DetachRolePolicy", 200, `<DetachRolePolicyResponse></DetachRolePolicyResponse>`).
+		on("GetPolicy", 200, getPolicyXML("v1"))
+
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec: iamv1beta1.IAMRoleSpec{
+			Description:                "d",
+			MaxSessionDuration:         3600,
+			TrustRelationship:          "{}",
+			Policies:                   []iamv1beta1.PolicyRef{{Name: "arn:aws:iam::123456789012:policy/Keep"}},
+			PolicyAttachmentMode:       mode,
+			InlinePolicyAttachmentMode: mode,
+		},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+	return &client, stub
+}
+
+func TestSyncIAMRoleExclusiveModeDetachesStrayManagedAndInlinePolicies(t *testing.T) {
+	client, stub := newAttachmentModeFixture(t, iamv1beta1.PolicyAttachmentModeExclusive)
+
+	if err := client.SyncIAMRole(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var detachedManaged, deletedInline bool
+	for _, c := range stub.calls {
+		if c == "DetachRolePolicy" {
+			detachedManaged = true
+		}
+		if c == "DeleteRolePolicy" {
+			deletedInline = true
+		}
+	}
+	if !detachedManaged {
+		t.Fatalf("expected the stray attached managed policy to be detached in Exclusive mode, got %v", stub.calls)
+	}
+	if !deletedInline {
+		t.Fatalf("expected the stray inline policy to be deleted in Exclusive mode, got %v", stub.calls)
+	}
+}
+
+func TestSyncIAMRoleAdditiveModeLeavesOutOfBandPoliciesAlone(t *testing.T) {
+	client, stub := newAttachmentModeFixture(t, iamv1beta1.PolicyAttachmentModeAdditive)
+
+	if err := client.SyncIAMRole(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range stub.calls {
+		if c == "DetachRolePolicy" || c == "DeleteRolePolicy" {
+			t.Fatalf("expected no detach/delete calls in Additive mode, got %v", stub.calls)
+		}
+	}
+}
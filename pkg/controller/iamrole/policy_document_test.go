@@ -0,0 +1,80 @@
+package iamrole
+
+import "testing"
+
+func TestPolicyDocumentsEqual(t *testing.T) {
+	cases := []struct {
+		name    string
+		awsDoc  string
+		specDoc string
+		want    bool
+	}{
+		{
+			name:    "identical documents",
+			awsDoc:  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/*"}]}`,
+			specDoc: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/*"}]}`,
+			want:    true,
+		},
+		{
+			name:    "key order is irrelevant",
+			awsDoc:  `{"Statement":[{"Resource":"*","Action":"s3:GetObject","Effect":"Allow"}],"Version":"2012-10-17"}`,
+			specDoc: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+			want:    true,
+		},
+		{
+			name:    "single string is equivalent to a single-element array",
+			awsDoc:  `{"Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}]}`,
+			specDoc: `{"Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+			want:    true,
+		},
+		{
+			name:    "array order within a sorted key is irrelevant",
+			awsDoc:  `{"Statement":[{"Effect":"Allow","Action":["s3:PutObject","s3:GetObject"]}]}`,
+			specDoc: `{"Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"]}]}`,
+			want:    true,
+		},
+		{
+			name:    "aws side is URL-decoded, spec side is taken literally",
+			awsDoc:  `%7B%22Statement%22%3A%5B%7B%22Effect%22%3A%22Allow%22%2C%22Action%22%3A%22s3%3AGetObject%22%7D%5D%7D`,
+			specDoc: `{"Statement":[{"Effect":"Allow","Action":"s3:GetObject"}]}`,
+			want:    true,
+		},
+		{
+			name:    "a literal plus in the spec is not corrupted into a space",
+			awsDoc:  `{"Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/path%2Bwith%2Bplus/*"}]}`,
+			specDoc: `{"Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/path+with+plus/*"}]}`,
+			want:    true,
+		},
+		{
+			name:    "genuinely different statements",
+			awsDoc:  `{"Statement":[{"Effect":"Allow","Action":"s3:GetObject"}]}`,
+			specDoc: `{"Statement":[{"Effect":"Deny","Action":"s3:GetObject"}]}`,
+			want:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := policyDocumentsEqual(tc.awsDoc, tc.specDoc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("policyDocumentsEqual(%q, %q) = %v, want %v", tc.awsDoc, tc.specDoc, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePolicyValueSortsOnlyConfiguredKeys(t *testing.T) {
+	// "Effect" is not in sortedPolicyKeys, so an array under it must be left in its original order
+	// even though it is a slice of strings, unlike Action/Resource/etc.
+	value := normalizePolicyValue("Effect", []interface{}{"b", "a"})
+	normalized, ok := value.([]interface{})
+	if !ok || len(normalized) != 2 {
+		t.Fatalf("expected a 2-element slice, got %#v", value)
+	}
+	if normalized[0] != "b" || normalized[1] != "a" {
+		t.Fatalf("expected order to be preserved for an unsorted key, got %#v", normalized)
+	}
+}
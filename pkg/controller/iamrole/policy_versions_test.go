@@ -0,0 +1,71 @@
+package iamrole
+
+import (
+	"testing"
+
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testPolicyArn = "arn:aws:iam::123456789012:policy/p"
+
+func getPolicyXML(versionID string) string {
+	return `<GetPolicyResponse><GetPolicyResult><Policy><PolicyName>p</PolicyName><PolicyId>ANPA1</PolicyId><Arn>` + testPolicyArn + `</Arn><Path>/</Path><DefaultVersionId>` + versionID + `</DefaultVersionId><AttachmentCount>1</AttachmentCount><IsAttachable>true</IsAttachable><CreateDate>2024-01-01T00:00:00Z</CreateDate><UpdateDate>2024-01-01T00:00:00Z</UpdateDate></Policy></GetPolicyResult></GetPolicyResponse>`
+}
+
+func TestSyncPolicyVersionsSeedsBaselineFromPinOnFirstObservation(t *testing.T) {
+	stub := newIAMAPIStub(t).on("GetPolicy", 200, getPolicyXML("v4"))
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{Policies: []iamv1beta1.PolicyRef{{Name: testPolicyArn, Version: "v3", AutoUpgrade: true}}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncPolicyVersions(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := role.Status.AttachedPolicyVersions[testPolicyArn]; got != "v4" {
+		t.Fatalf("expected v4 to be recorded, got %q", got)
+	}
+}
+
+// TestSyncPolicyVersionsConvergesOnceRecorded is the regression test for re-reading a pinned version
+// as the baseline: once a version has been recorded in status, a pinned PolicyRef.Version must not be re-read as
+// the baseline on the next call, or a pinned+AutoUpgrade ref would re-fire the same upgrade event and
+// status write every single reconcile forever.
+func TestSyncPolicyVersionsConvergesOnceRecorded(t *testing.T) {
+	stub := newIAMAPIStub(t).on("GetPolicy", 200, getPolicyXML("v4"))
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{Policies: []iamv1beta1.PolicyRef{{Name: testPolicyArn, Version: "v3", AutoUpgrade: true}}},
+		Status:     iamv1beta1.IAMRoleStatus{AttachedPolicyVersions: map[string]string{testPolicyArn: "v4"}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncPolicyVersions(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(role.Status.Conditions) != 0 {
+		t.Fatalf("expected no drift condition once the recorded baseline already matches the latest version, got %v", role.Status.Conditions)
+	}
+}
+
+func TestSyncPolicyVersionsSurfacesConditionWithoutAutoUpgrade(t *testing.T) {
+	stub := newIAMAPIStub(t).on("GetPolicy", 200, getPolicyXML("v4"))
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{Policies: []iamv1beta1.PolicyRef{{Name: testPolicyArn, Version: "v3", AutoUpgrade: false}}},
+		Status:     iamv1beta1.IAMRoleStatus{AttachedPolicyVersions: map[string]string{testPolicyArn: "v3"}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncPolicyVersions(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(role.Status.Conditions) != 1 || role.Status.Conditions[0].Type != iamv1beta1.PolicyUpgradeAvailable {
+		t.Fatalf("expected a single PolicyUpgradeAvailable condition, got %v", role.Status.Conditions)
+	}
+	if got := role.Status.AttachedPolicyVersions[testPolicyArn]; got != "v3" {
+		t.Fatalf("expected the baseline to remain pinned at v3 without AutoUpgrade, got %q", got)
+	}
+}
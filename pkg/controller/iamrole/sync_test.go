@@ -0,0 +1,104 @@
+package iamrole
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncTagsUntagsAndTagsToConverge(t *testing.T) {
+	stub := newIAMAPIStub(t).
+		on("ListRoleTags", 200, `<ListRoleTagsResponse><ListRoleTagsResult><Tags><member><Key>keep</Key><Value>same</Value></member><member><Key>stale</Key><Value>old</Value></member><member><Key>change</Key><Value>old-value</Value></member></Tags><IsTruncated>false</IsTruncated></ListRoleTagsResult></ListRoleTagsResponse>`).
+		on("UntagRole", 200, `<UntagRoleResponse></UntagRoleResponse>`).
+		on("TagRole", 200, `<TagRoleResponse></TagRoleResponse>`)
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{Tags: map[string]string{"keep": "same", "change": "new-value", "added": "v"}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncTags("my-role"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	called := map[string]bool{}
+	for _, c := range stub.calls {
+		called[c] = true
+	}
+	if !called["UntagRole"] {
+		t.Fatal("expected the stale tag to be removed via UntagRole")
+	}
+	if !called["TagRole"] {
+		t.Fatal("expected the changed/added tags to be written via TagRole")
+	}
+	if role.Status.Tags["change"] != "new-value" {
+		t.Fatalf("expected status to record the spec's tag set, got %v", role.Status.Tags)
+	}
+}
+
+func TestSyncTagsNoopWhenAlreadyConverged(t *testing.T) {
+	stub := newIAMAPIStub(t).
+		on("ListRoleTags", 200, `<ListRoleTagsResponse><ListRoleTagsResult><Tags><member><Key>keep</Key><Value>same</Value></member></Tags><IsTruncated>false</IsTruncated></ListRoleTagsResult></ListRoleTagsResponse>`)
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{Tags: map[string]string{"keep": "same"}},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncTags("my-role"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stub.calls) != 1 {
+		t.Fatalf("expected only the ListRoleTags read, got %v", stub.calls)
+	}
+}
+
+func TestSyncPermissionsBoundarySetsWhenMissing(t *testing.T) {
+	stub := newIAMAPIStub(t).on("PutRolePermissionsBoundary", 200, `<PutRolePermissionsBoundaryResponse></PutRolePermissionsBoundaryResponse>`)
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{PermissionsBoundary: testPolicyArn},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+
+	if err := client.syncPermissionsBoundary(iam.Role{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if role.Status.PermissionsBoundaryARN != testPolicyArn {
+		t.Fatalf("expected the new boundary ARN to be recorded, got %q", role.Status.PermissionsBoundaryARN)
+	}
+}
+
+func TestSyncPermissionsBoundaryRemovesWhenUnset(t *testing.T) {
+	stub := newIAMAPIStub(t).on("DeleteRolePermissionsBoundary", 200, `<DeleteRolePermissionsBoundaryResponse></DeleteRolePermissionsBoundaryResponse>`)
+	role := &iamv1beta1.IAMRole{ObjectMeta: metav1.ObjectMeta{Name: "my-role"}}
+	client := IAMClient{Client: stub.client(), Role: role}
+	arn := testPolicyArn
+	awsRole := iam.Role{PermissionsBoundary: &iam.AttachedPermissionsBoundary{PermissionsBoundaryArn: &arn}}
+
+	if err := client.syncPermissionsBoundary(awsRole); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if role.Status.PermissionsBoundaryARN != "" {
+		t.Fatalf("expected status to be cleared, got %q", role.Status.PermissionsBoundaryARN)
+	}
+}
+
+func TestSyncPermissionsBoundaryNoopWhenAlreadyConverged(t *testing.T) {
+	stub := newIAMAPIStub(t)
+	role := &iamv1beta1.IAMRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-role"},
+		Spec:       iamv1beta1.IAMRoleSpec{PermissionsBoundary: testPolicyArn},
+	}
+	client := IAMClient{Client: stub.client(), Role: role}
+	arn := testPolicyArn
+	awsRole := iam.Role{PermissionsBoundary: &iam.AttachedPermissionsBoundary{PermissionsBoundaryArn: &arn}}
+
+	if err := client.syncPermissionsBoundary(awsRole); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stub.calls) != 0 {
+		t.Fatalf("expected no AWS calls once the boundary already matches, got %v", stub.calls)
+	}
+}
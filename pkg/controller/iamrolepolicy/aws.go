@@ -0,0 +1,41 @@
+package iamrolepolicy
+
+import (
+	"github.com/aws/aws-sdk-go/service/iam"
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+)
+
+// IAMClient provides an interface for interacting with AWS on behalf of an IAMRolePolicy
+type IAMClient struct {
+	Client *iam.IAM
+	Policy *iamv1beta1.IAMRolePolicy
+}
+
+// NewIAMClient returns a new client for interacting with AWS IAM
+func NewIAMClient(client *iam.IAM, policy *iamv1beta1.IAMRolePolicy) IAMClient {
+	return IAMClient{
+		Client: client,
+		Policy: policy,
+	}
+}
+
+// ApplyIAMRolePolicy puts the inline policy on its referenced role, creating or updating it
+func (i *IAMClient) ApplyIAMRolePolicy() error {
+	roleName := i.Policy.Spec.RoleRef.Name
+	_, err := i.Client.PutRolePolicy(&iam.PutRolePolicyInput{
+		RoleName:       &roleName,
+		PolicyName:     &i.Policy.Spec.PolicyName,
+		PolicyDocument: &i.Policy.Spec.PolicyDocument,
+	})
+	return err
+}
+
+// DeleteIAMRolePolicy removes the inline policy from its referenced role
+func (i *IAMClient) DeleteIAMRolePolicy() error {
+	roleName := i.Policy.Spec.RoleRef.Name
+	_, err := i.Client.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+		RoleName:   &roleName,
+		PolicyName: &i.Policy.Spec.PolicyName,
+	})
+	return err
+}
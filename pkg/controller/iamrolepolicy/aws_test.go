@@ -0,0 +1,18 @@
+package iamrolepolicy
+
+import "testing"
+
+func TestFinalizerHelpers(t *testing.T) {
+	var finalizers []string
+	if containsString(finalizers, rolePolicyFinalizer) {
+		t.Fatal("expected finalizer to be absent initially")
+	}
+	finalizers = append(finalizers, rolePolicyFinalizer)
+	if !containsString(finalizers, rolePolicyFinalizer) {
+		t.Fatal("expected finalizer to be present after adding it")
+	}
+	finalizers = removeString(finalizers, rolePolicyFinalizer)
+	if containsString(finalizers, rolePolicyFinalizer) {
+		t.Fatal("expected finalizer to be removed")
+	}
+}
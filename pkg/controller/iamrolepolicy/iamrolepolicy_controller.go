@@ -0,0 +1,163 @@
+/*
+Copyright 2018 Ian Hoegen.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iamrolepolicy
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// rolePolicyFinalizer lets us clean up the inline policy in AWS before the IAMRolePolicy is removed from etcd
+const rolePolicyFinalizer = "iam.amazonaws.com/rolepolicy-finalizer"
+
+var eventRecorder record.EventRecorder
+
+// iamSvc is built once in Add rather than per-reconcile: constructing a session on every reconcile
+// is slow for no benefit, mirroring the same fix applied to the iamrole controller.
+var iamSvc *iam.IAM
+
+// Add creates a new IAMRolePolicy Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	log.Println("IAMRolePolicy controller added")
+	iamSvc = iam.New(session.New())
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileIAMRolePolicy{Client: mgr.GetClient(), scheme: mgr.GetScheme()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("iamrolepolicy-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to IAMRolePolicy
+	err = c.Watch(&source.Kind{Type: &iamv1beta1.IAMRolePolicy{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+	eventRecorder = mgr.GetRecorder("iamrolepolicy")
+	return nil
+}
+
+// rolePolicyAWSClient is the subset of IAMClient behavior Reconcile depends on. It exists so tests
+// can substitute a fake and exercise the finalizer state machine without making real AWS calls.
+type rolePolicyAWSClient interface {
+	ApplyIAMRolePolicy() error
+	DeleteIAMRolePolicy() error
+}
+
+// newRolePolicyAWSClient is a package-level var, rather than a direct NewIAMClient call, so tests
+// can swap in a fake rolePolicyAWSClient.
+var newRolePolicyAWSClient = func(client *iam.IAM, policy *iamv1beta1.IAMRolePolicy) rolePolicyAWSClient {
+	ic := NewIAMClient(client, policy)
+	return &ic
+}
+
+var _ reconcile.Reconciler = &ReconcileIAMRolePolicy{}
+
+// ReconcileIAMRolePolicy reconciles a IAMRolePolicy object
+type ReconcileIAMRolePolicy struct {
+	client.Client
+	scheme *runtime.Scheme
+}
+
+// Reconcile reads that state of the cluster for a IAMRolePolicy object and puts or deletes the
+// corresponding inline policy on its referenced IAMRole
+// +kubebuilder:rbac:groups=iam.amazonaws.com,resources=iamrolepolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch;delete
+func (r *ReconcileIAMRolePolicy) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	// Fetch the IAMRolePolicy instance
+	rolePolicy := &iamv1beta1.IAMRolePolicy{}
+	err := r.Get(context.TODO(), request.NamespacedName, rolePolicy)
+	if err != nil {
+		// IAMRolePolicy deleted from the cluster; nothing left to do, the finalizer already handled AWS cleanup
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	awsClient := newRolePolicyAWSClient(iamSvc, rolePolicy)
+
+	// IAMRolePolicy is being deleted
+	if !rolePolicy.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !containsString(rolePolicy.ObjectMeta.Finalizers, rolePolicyFinalizer) {
+			return reconcile.Result{}, nil
+		}
+		if err := awsClient.DeleteIAMRolePolicy(); err != nil {
+			eventRecorder.Event(rolePolicy, "Warning", "ErrorDeletingIAMRolePolicy", err.Error())
+			return reconcile.Result{}, err
+		}
+		rolePolicy.ObjectMeta.Finalizers = removeString(rolePolicy.ObjectMeta.Finalizers, rolePolicyFinalizer)
+		return reconcile.Result{}, r.Update(context.TODO(), rolePolicy)
+	}
+
+	// Make sure the finalizer is present before we touch AWS state
+	if !containsString(rolePolicy.ObjectMeta.Finalizers, rolePolicyFinalizer) {
+		rolePolicy.ObjectMeta.Finalizers = append(rolePolicy.ObjectMeta.Finalizers, rolePolicyFinalizer)
+		if err := r.Update(context.TODO(), rolePolicy); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if err := awsClient.ApplyIAMRolePolicy(); err != nil {
+		eventRecorder.Event(rolePolicy, "Warning", "ErrorApplyingIAMRolePolicy", err.Error())
+		return reconcile.Result{}, err
+	}
+	rolePolicy.Status.RoleName = rolePolicy.Spec.RoleRef.Name
+	rolePolicy.Status.Applied = true
+	if err := r.Update(context.TODO(), rolePolicy); err != nil {
+		return reconcile.Result{}, err
+	}
+	eventRecorder.Event(rolePolicy, "Normal", "IAMRolePolicyApplied", "Successfully applied inline policy to IAM role")
+	return reconcile.Result{}, nil
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(slice []string, s string) []string {
+	var result []string
+	for _, item := range slice {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,181 @@
+package iamrolepolicy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	iamv1beta1 "github.com/ihoegen/iam-role-manager/pkg/apis/iam/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeRolePolicyAWSClient is a rolePolicyAWSClient test double: it records what Reconcile asked of
+// it instead of making real AWS calls.
+type fakeRolePolicyAWSClient struct {
+	applyCalls, deleteCalls int
+	applyErr, deleteErr     error
+}
+
+func (f *fakeRolePolicyAWSClient) ApplyIAMRolePolicy() error {
+	f.applyCalls++
+	return f.applyErr
+}
+
+func (f *fakeRolePolicyAWSClient) DeleteIAMRolePolicy() error {
+	f.deleteCalls++
+	return f.deleteErr
+}
+
+// stubRolePolicyAWSClient overrides newRolePolicyAWSClient for the duration of a test.
+func stubRolePolicyAWSClient(fake rolePolicyAWSClient) func() {
+	original := newRolePolicyAWSClient
+	newRolePolicyAWSClient = func(*iam.IAM, *iamv1beta1.IAMRolePolicy) rolePolicyAWSClient { return fake }
+	return func() { newRolePolicyAWSClient = original }
+}
+
+// setFakeEventRecorder overrides the package-level eventRecorder for the duration of a test.
+func setFakeEventRecorder() func() {
+	original := eventRecorder
+	eventRecorder = record.NewFakeRecorder(10)
+	return func() { eventRecorder = original }
+}
+
+// fakeK8sClient is a minimal client.Client test double backing a single IAMRolePolicy, enough to
+// drive ReconcileIAMRolePolicy.Reconcile without a real API server.
+type fakeK8sClient struct {
+	rolePolicy *iamv1beta1.IAMRolePolicy
+}
+
+func (f *fakeK8sClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	rolePolicy, ok := obj.(*iamv1beta1.IAMRolePolicy)
+	if !ok {
+		return fmt.Errorf("fakeK8sClient.Get: unsupported type %T", obj)
+	}
+	if f.rolePolicy == nil || key.Name != f.rolePolicy.Name || key.Namespace != f.rolePolicy.Namespace {
+		return errors.NewNotFound(schema.GroupResource{Group: "iam.amazonaws.com", Resource: "iamrolepolicies"}, key.Name)
+	}
+	*rolePolicy = *f.rolePolicy
+	return nil
+}
+
+func (f *fakeK8sClient) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	return fmt.Errorf("fakeK8sClient.List: not implemented")
+}
+
+func (f *fakeK8sClient) Create(ctx context.Context, obj runtime.Object) error {
+	return fmt.Errorf("fakeK8sClient.Create: not implemented")
+}
+
+func (f *fakeK8sClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	return fmt.Errorf("fakeK8sClient.Delete: not implemented")
+}
+
+func (f *fakeK8sClient) Update(ctx context.Context, obj runtime.Object) error {
+	rolePolicy, ok := obj.(*iamv1beta1.IAMRolePolicy)
+	if !ok {
+		return fmt.Errorf("fakeK8sClient.Update: unsupported type %T", obj)
+	}
+	updated := *rolePolicy
+	f.rolePolicy = &updated
+	return nil
+}
+
+func (f *fakeK8sClient) Status() client.StatusWriter {
+	return f
+}
+
+func TestReconcileIAMRolePolicy_AddsFinalizerAndApplies(t *testing.T) {
+	defer setFakeEventRecorder()()
+
+	rolePolicy := &iamv1beta1.IAMRolePolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-policy", Namespace: "default"},
+		Spec:       iamv1beta1.IAMRolePolicySpec{RoleRef: iamv1beta1.RoleReference{Name: "my-role"}},
+	}
+	fakeClient := &fakeK8sClient{rolePolicy: rolePolicy}
+	fakeAWS := &fakeRolePolicyAWSClient{}
+	defer stubRolePolicyAWSClient(fakeAWS)()
+
+	r := &ReconcileIAMRolePolicy{Client: fakeClient}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "my-policy", Namespace: "default"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !containsString(fakeClient.rolePolicy.Finalizers, rolePolicyFinalizer) {
+		t.Fatal("expected finalizer to be added on first reconcile")
+	}
+	if fakeAWS.applyCalls != 1 {
+		t.Fatalf("expected ApplyIAMRolePolicy to be called once, got %d", fakeAWS.applyCalls)
+	}
+	if fakeAWS.deleteCalls != 0 {
+		t.Fatalf("expected DeleteIAMRolePolicy not to be called, got %d", fakeAWS.deleteCalls)
+	}
+	if !fakeClient.rolePolicy.Status.Applied {
+		t.Fatal("expected Status.Applied to be set")
+	}
+}
+
+func TestReconcileIAMRolePolicy_SkipsDeleteWhenFinalizerAlreadyRemoved(t *testing.T) {
+	defer setFakeEventRecorder()()
+
+	deletionTime := metav1.NewTime(time.Now())
+	rolePolicy := &iamv1beta1.IAMRolePolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "my-policy",
+			Namespace:         "default",
+			DeletionTimestamp: &deletionTime,
+		},
+	}
+	fakeClient := &fakeK8sClient{rolePolicy: rolePolicy}
+	fakeAWS := &fakeRolePolicyAWSClient{}
+	defer stubRolePolicyAWSClient(fakeAWS)()
+
+	r := &ReconcileIAMRolePolicy{Client: fakeClient}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "my-policy", Namespace: "default"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fakeAWS.deleteCalls != 0 {
+		t.Fatalf("expected no DeleteIAMRolePolicy call once the finalizer is already gone, got %d", fakeAWS.deleteCalls)
+	}
+}
+
+func TestReconcileIAMRolePolicy_DeletesAndRemovesFinalizerOnDeletionTimestamp(t *testing.T) {
+	defer setFakeEventRecorder()()
+
+	deletionTime := metav1.NewTime(time.Now())
+	rolePolicy := &iamv1beta1.IAMRolePolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "my-policy",
+			Namespace:         "default",
+			DeletionTimestamp: &deletionTime,
+			Finalizers:        []string{rolePolicyFinalizer},
+		},
+	}
+	fakeClient := &fakeK8sClient{rolePolicy: rolePolicy}
+	fakeAWS := &fakeRolePolicyAWSClient{}
+	defer stubRolePolicyAWSClient(fakeAWS)()
+
+	r := &ReconcileIAMRolePolicy{Client: fakeClient}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "my-policy", Namespace: "default"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fakeAWS.deleteCalls != 1 {
+		t.Fatalf("expected DeleteIAMRolePolicy to be called once, got %d", fakeAWS.deleteCalls)
+	}
+	if containsString(fakeClient.rolePolicy.Finalizers, rolePolicyFinalizer) {
+		t.Fatal("expected finalizer to be removed after delete")
+	}
+}